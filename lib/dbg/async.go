@@ -0,0 +1,209 @@
+package dbg
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// DropPolicy controls what the async log pipeline does with a Record when
+// its buffer is full.
+type DropPolicy int
+
+const (
+	// PolicyBlock makes the caller wait until there is room in the
+	// buffer - no record is ever lost, but a slow consumer can make
+	// Lvl*-calls block.
+	PolicyBlock DropPolicy = iota
+	// PolicyDropNew discards the incoming record and keeps whatever is
+	// already queued.
+	PolicyDropNew
+	// PolicyDropOldest discards the oldest queued record to make room
+	// for the incoming one.
+	PolicyDropOldest
+)
+
+// pipelineItem is what actually travels through the pipeline's channel.
+// A zero-value rec together with a non-nil barrier is a Flush request,
+// not a log line - it is never handed to a Handler.
+type pipelineItem struct {
+	rec     Record
+	barrier chan struct{}
+}
+
+// logPipeline hands Records to a background goroutine over a bounded
+// channel, so that Lvl*/Print/Error/...-calls only pay for an atomic
+// level check and an enqueue - formatting and writing to the configured
+// Handler happens entirely off the caller's stack.
+type logPipeline struct {
+	ch      chan pipelineItem
+	policy  DropPolicy
+	dropped uint64
+	stopped int32
+	wg      sync.WaitGroup
+}
+
+func newPipeline(bufSize int, policy DropPolicy) *logPipeline {
+	if bufSize <= 0 {
+		bufSize = 1
+	}
+	p := &logPipeline{
+		ch:     make(chan pipelineItem, bufSize),
+		policy: policy,
+	}
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+func (p *logPipeline) run() {
+	defer p.wg.Done()
+	for item := range p.ch {
+		if item.barrier != nil {
+			close(item.barrier)
+			continue
+		}
+		GetHandler().Handle(item.rec)
+	}
+}
+
+// fallbackMu serializes the synchronous-fallback Handle calls enqueue
+// makes once a pipeline has been shut down. Normally a single pipeline
+// consumer goroutine serializes every Handle call, including its access
+// to Handler state that isn't itself safe for concurrent use (formatLine
+// mutating NamePadding/LinePadding, terminalHandler.Handle writing
+// TestStr) - once Shutdown has returned, there is no such goroutine left,
+// so any number of callers can still be logging concurrently and need
+// this mutex in its place.
+var fallbackMu sync.Mutex
+
+// enqueue hands r to the pipeline according to its DropPolicy. Once the
+// pipeline has been shut down, it falls back to handling r synchronously
+// so that nothing logged after Shutdown is silently lost.
+func (p *logPipeline) enqueue(r Record) {
+	if atomic.LoadInt32(&p.stopped) == 1 {
+		fallbackMu.Lock()
+		defer fallbackMu.Unlock()
+		GetHandler().Handle(r)
+		return
+	}
+	item := pipelineItem{rec: r}
+	switch p.policy {
+	case PolicyDropNew:
+		select {
+		case p.ch <- item:
+		default:
+			atomic.AddUint64(&p.dropped, 1)
+		}
+	case PolicyDropOldest:
+		for {
+			select {
+			case p.ch <- item:
+				return
+			default:
+			}
+			select {
+			case <-p.ch:
+				atomic.AddUint64(&p.dropped, 1)
+			default:
+			}
+		}
+	default: // PolicyBlock
+		p.ch <- item
+	}
+}
+
+// Dropped returns the number of records this pipeline has discarded under
+// PolicyDropNew/PolicyDropOldest since it was created.
+func (p *logPipeline) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// flush blocks until every record enqueued before the call has been
+// handled, or ctx is done. On a pipeline that has been shut down it
+// returns nil at once, since records are then handled synchronously.
+func (p *logPipeline) flush(ctx context.Context) error {
+	if atomic.LoadInt32(&p.stopped) == 1 {
+		return nil
+	}
+	item := pipelineItem{barrier: make(chan struct{})}
+	select {
+	case p.ch <- item:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-item.barrier:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown flushes, then stops the background goroutine. After it
+// returns nil, further records are handled synchronously on the caller's
+// own stack rather than being lost. If ctx is done before the flush
+// completes, the pipeline keeps running. Shutting down a pipeline that
+// is already stopped returns nil.
+func (p *logPipeline) shutdown(ctx context.Context) error {
+	if atomic.LoadInt32(&p.stopped) == 1 {
+		return nil
+	}
+	if err := p.flush(ctx); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&p.stopped, 1)
+	close(p.ch)
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var (
+	pipelineMut sync.RWMutex
+	pipeline    = newPipeline(1024, PolicyBlock)
+)
+
+func getPipeline() *logPipeline {
+	pipelineMut.RLock()
+	defer pipelineMut.RUnlock()
+	return pipeline
+}
+
+// SetAsyncConfig replaces the async log pipeline with a freshly created
+// one of the given buffer size and overflow policy. The previous
+// pipeline is flushed and shut down in the background so that records
+// already queued on it are not lost.
+func SetAsyncConfig(bufSize int, policy DropPolicy) {
+	next := newPipeline(bufSize, policy)
+
+	pipelineMut.Lock()
+	prev := pipeline
+	pipeline = next
+	pipelineMut.Unlock()
+
+	go prev.shutdown(context.Background())
+}
+
+// Flush blocks until every record enqueued before the call has reached
+// the configured Handler.
+func Flush() {
+	getPipeline().flush(context.Background())
+}
+
+// Shutdown flushes the async log pipeline and stops its background
+// goroutine, honouring ctx's deadline/cancellation. Top-level binaries
+// should call this before exiting so that buffered records - especially
+// a Fatal/Panic that raced the process shutting down - are not lost.
+// After Shutdown returns nil, further log calls are handled synchronously.
+func Shutdown(ctx context.Context) error {
+	return getPipeline().shutdown(ctx)
+}
@@ -0,0 +1,228 @@
+package dbg
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingHandler.Handle signals started (if non-nil), then blocks until
+// released, so tests can pin a pipeline's single in-flight consumer call
+// and deterministically control exactly how many items are queued behind
+// it instead of racing the background goroutine.
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (blockingHandler) Enabled(int) bool { return true }
+
+func (h blockingHandler) Handle(Record) error {
+	if h.started != nil {
+		// Non-blocking: only the first call is awaited by the test, and a
+		// later call here must never be able to deadlock waiting for a
+		// receiver that isn't coming.
+		select {
+		case h.started <- struct{}{}:
+		default:
+		}
+	}
+	<-h.release
+	return nil
+}
+
+func TestPipelineDropNew(t *testing.T) {
+	orig := GetHandler()
+	defer SetHandler(orig)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	SetHandler(blockingHandler{started: started, release: release})
+
+	p := newPipeline(1, PolicyDropNew)
+	defer p.shutdown(context.Background())
+	defer close(release)
+
+	p.enqueue(Record{}) // picked up by run(), blocks in Handle
+	<-started           // wait until it's actually blocked, so the buffer is empty
+	p.enqueue(Record{}) // fills the buffer
+	p.enqueue(Record{}) // buffer full -> dropped
+	p.enqueue(Record{}) // buffer full -> dropped
+
+	if got := p.Dropped(); got != 2 {
+		t.Fatalf("Dropped() = %d, want 2", got)
+	}
+}
+
+func TestPipelineDropOldest(t *testing.T) {
+	orig := GetHandler()
+	defer SetHandler(orig)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	SetHandler(blockingHandler{started: started, release: release})
+
+	p := newPipeline(1, PolicyDropOldest)
+	defer p.shutdown(context.Background())
+	defer close(release)
+
+	p.enqueue(Record{Msg: "a"}) // picked up by run(), blocks in Handle
+	<-started                   // wait until it's actually blocked, so the buffer is empty
+	p.enqueue(Record{Msg: "b"}) // fills the buffer
+	p.enqueue(Record{Msg: "c"}) // evicts "b" to make room for "c"
+
+	if got := p.Dropped(); got != 1 {
+		t.Fatalf("Dropped() = %d, want 1", got)
+	}
+	select {
+	case item := <-p.ch:
+		if item.rec.Msg != "c" {
+			t.Fatalf("queued record = %q, want %q", item.rec.Msg, "c")
+		}
+	default:
+		t.Fatal("expected the surviving record still queued")
+	}
+}
+
+func TestPipelineBlockPolicy(t *testing.T) {
+	orig := GetHandler()
+	defer SetHandler(orig)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	SetHandler(blockingHandler{started: started, release: release})
+
+	p := newPipeline(1, PolicyBlock)
+	defer p.shutdown(context.Background())
+
+	p.enqueue(Record{}) // picked up by run(), blocks in Handle
+	<-started           // wait until it's actually blocked, so the buffer is empty
+	p.enqueue(Record{}) // fills the buffer
+
+	done := make(chan struct{})
+	go func() {
+		p.enqueue(Record{}) // buffer full -> must block until consumer drains
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("enqueue returned before the consumer made room")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue never returned after the consumer was released")
+	}
+}
+
+// recordingHandler appends every Record it's given, guarded by a mutex so
+// it's safe to read from the test goroutine.
+type recordingHandler struct {
+	mu      *sync.Mutex
+	records *[]Record
+}
+
+func (recordingHandler) Enabled(int) bool { return true }
+
+func (h recordingHandler) Handle(r Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*h.records = append(*h.records, r)
+	return nil
+}
+
+func TestFlushWaitsForQueuedRecords(t *testing.T) {
+	orig := GetHandler()
+	defer SetHandler(orig)
+
+	var mu sync.Mutex
+	var got []Record
+	SetHandler(recordingHandler{mu: &mu, records: &got})
+
+	p := newPipeline(8, PolicyBlock)
+	defer p.shutdown(context.Background())
+
+	for i := 0; i < 5; i++ {
+		p.enqueue(Record{Msg: "x"})
+	}
+	if err := p.flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	mu.Lock()
+	n := len(got)
+	mu.Unlock()
+	if n != 5 {
+		t.Fatalf("after flush: %d records handled, want 5", n)
+	}
+}
+
+func TestShutdownFlushesThenHandlesSynchronously(t *testing.T) {
+	orig := GetHandler()
+	defer SetHandler(orig)
+
+	var mu sync.Mutex
+	var got []Record
+	SetHandler(recordingHandler{mu: &mu, records: &got})
+
+	p := newPipeline(8, PolicyBlock)
+	for i := 0; i < 3; i++ {
+		p.enqueue(Record{Msg: "x"})
+	}
+	if err := p.shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	mu.Lock()
+	n := len(got)
+	mu.Unlock()
+	if n != 3 {
+		t.Fatalf("after shutdown: %d records handled, want 3", n)
+	}
+
+	// A Record enqueued post-shutdown must still reach the Handler - just
+	// synchronously, on the caller's own stack.
+	p.enqueue(Record{Msg: "y"})
+	mu.Lock()
+	n = len(got)
+	mu.Unlock()
+	if n != 4 {
+		t.Fatalf("after post-shutdown enqueue: %d records handled, want 4", n)
+	}
+}
+
+// TestPostShutdownEnqueueIsRaceFree guards the synchronous fallback path:
+// once a pipeline is shut down, every further enqueue() calls Handle
+// directly on the caller's own goroutine, with no pipeline-consumer
+// goroutine left to serialize access to Handler state like formatLine's
+// NamePadding/LinePadding. Without fallbackMu, running this with -race
+// fails immediately.
+func TestPostShutdownEnqueueIsRaceFree(t *testing.T) {
+	orig := GetHandler()
+	defer SetHandler(orig)
+	SetHandler(TextHandler(io.Discard))
+
+	p := newPipeline(1, PolicyBlock)
+	if err := p.shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	var start sync.WaitGroup
+	start.Add(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start.Wait()
+			p.enqueue(Record{Caller: strings.Repeat("x", i+1), Line: i, Msg: "concurrent\n"})
+		}(i)
+	}
+	start.Done()
+	wg.Wait()
+}
@@ -17,7 +17,6 @@ package dbg
 import (
 	"flag"
 	"fmt"
-	"github.com/daviddengcn/go-colortext"
 	"os"
 	"regexp"
 	"runtime"
@@ -40,7 +39,11 @@ var showTime = false
 // If useColors is true, debug-output will be colored
 var useColors = true
 
-var debugMut sync.RWMutex
+// varMut guards the simple package-wide settings below (debugVisible,
+// showTime, useColors). It has nothing to do with handlerMut in
+// handler.go, which only guards swapping the root Handler - formatting
+// and writing a Record never happens while either lock is held.
+var varMut sync.RWMutex
 
 // The padding of functions to make a nice debug-output - this is automatically updated
 // whenever there are longer functions and kept at that new maximum. If you prefer
@@ -73,16 +76,38 @@ const (
 	LvlPanic
 )
 
-func lvl(lvl int, args ...interface{}) {
-	debugMut.Lock()
-	defer debugMut.Unlock()
-
-	if lvl > debugVisible {
+// lvl builds a Record for a single Lvl*/Print/Error/...-call and enqueues
+// it on the async log pipeline (see async.go), whose background goroutine
+// hands it to the root Handler configured at that time. On the caller's
+// stack, lvl only does the level check and the enqueue - formatting and
+// writing happen in the pipeline's consumer (or, once the pipeline has
+// been shut down, synchronously in enqueue), so concurrent callers no
+// longer serialize on a single global mutex. kv carries the key/value fields attached to this
+// call (a Logger's inherited context plus, for the *Kv functions, the
+// fields given at the call-site); it is nil for plain calls.
+func lvl(lvl int, kv []interface{}, args ...interface{}) {
+	pc, _, line, _ := runtime.Caller(3)
+	fullName := runtime.FuncForPC(pc).Name()
+	name := regexpPaths.ReplaceAllString(fullName, "")
+
+	// A vmodule rule for this call-site, if any, overrides the global
+	// debugVisible threshold.
+	visible := DebugVisible()
+	vlvl, vmatched := vmoduleLevel(pc, fullName)
+	if vmatched {
+		visible = vlvl
+	}
+	if lvl > visible {
+		return
+	}
+	h := GetHandler()
+	// h.Enabled only knows about the global debugVisible level, so
+	// honouring it here would silently undo a vmodule rule that raised
+	// the threshold for this call-site - the visible check above has
+	// already made the right call in that case.
+	if !vmatched && !h.Enabled(lvl) {
 		return
 	}
-	pc, _, line, _ := runtime.Caller(3)
-	name := regexpPaths.ReplaceAllString(runtime.FuncForPC(pc).Name(), "")
-	lineStr := fmt.Sprintf("%d", line)
 
 	// For the testing-framework, we check the resulting string. So as not to
 	// have the tests fail every time somebody moves the functions, we put
@@ -91,69 +116,17 @@ func lvl(lvl int, args ...interface{}) {
 		line = 0
 	}
 
-	if len(name) > NamePadding && NamePadding > 0 {
-		NamePadding = len(name)
-	}
-	if len(lineStr) > LinePadding && LinePadding > 0 {
-		LinePadding = len(name)
-	}
-	fmtstr := fmt.Sprintf("%%%ds: %%%dd", NamePadding, LinePadding)
-	caller := fmt.Sprintf(fmtstr, name, line)
-	if StaticMsg != "" {
-		caller += "@" + StaticMsg
-	}
-	message := fmt.Sprintln(args...)
-	bright := lvl < 0
-	lvlAbs := lvl
-	if bright {
-		lvlAbs *= -1
-	}
-	lvlStr := strconv.Itoa(lvlAbs)
-	if lvl < 0 {
-		lvlStr += "!"
-	}
-	switch lvl {
-	case LvlPrint:
-		fg(ct.White, true)
-		lvlStr = "I"
-	case LvlWarning:
-		fg(ct.Green, true)
-		lvlStr = "W"
-	case LvlError:
-		fg(ct.Red, false)
-		lvlStr = "E"
-	case LvlFatal:
-		fg(ct.Red, true)
-		lvlStr = "F"
-	case LvlPanic:
-		fg(ct.Red, true)
-		lvlStr = "P"
-	default:
-		if lvl != 0 {
-			if lvlAbs <= 5 {
-				colors := []ct.Color{ct.Yellow, ct.Cyan, ct.Green, ct.Blue, ct.Cyan}
-				fg(colors[lvlAbs-1], bright)
-			}
-		}
-	}
-	str := fmt.Sprintf(": (%s) - %s", caller, message)
-	if showTime {
-		ti := time.Now()
-		str = fmt.Sprintf("%s.%09d%s", ti.Format("06/02/01 15:04:05"), ti.Nanosecond(), str)
-	}
-	TestStr = fmt.Sprintf("%-2s%s", lvlStr, str)
-	if Testing != 2 {
-		fmt.Print(TestStr)
-	}
-	if useColors {
-		ct.ResetColor()
-	}
-}
-
-func fg(c ct.Color, bright bool) {
-	if useColors {
-		ct.Foreground(c, bright)
+	r := Record{
+		Time:      time.Now(),
+		Lvl:       lvl,
+		Caller:    name,
+		Line:      line,
+		StaticMsg: StaticMsg,
+		Msg:       fmt.Sprintln(args...),
+		Args:      args,
+		KV:        kv,
 	}
+	getPipeline().enqueue(r)
 }
 
 // Needs two functions to keep the caller-depth the same and find who calls us
@@ -161,10 +134,10 @@ func fg(c ct.Color, bright bool) {
 // or
 // Lvl1 -> lvld -> lvl
 func lvlf(l int, f string, args ...interface{}) {
-	lvl(l, fmt.Sprintf(f, args...))
+	lvl(l, nil, fmt.Sprintf(f, args...))
 }
 func lvld(l int, args ...interface{}) {
-	lvl(l, args...)
+	lvl(l, nil, args...)
 }
 
 // Print directly sends the arguments to the stdout
@@ -217,12 +190,14 @@ func Warn(args ...interface{}) {
 // Fatal prints out the fatal message and quits
 func Fatal(args ...interface{}) {
 	lvld(LvlFatal, args...)
+	Flush()
 	os.Exit(1)
 }
 
 // Panic prints out the panic message and panics
 func Panic(args ...interface{}) {
 	lvld(LvlPanic, args...)
+	Flush()
 	panic(args)
 }
 
@@ -254,6 +229,7 @@ func Lvlf5(f string, args ...interface{}) {
 // Fatalf is like Fatal but with a format-string
 func Fatalf(f string, args ...interface{}) {
 	lvlf(LvlFatal, f, args...)
+	Flush()
 	os.Exit(1)
 }
 
@@ -270,6 +246,7 @@ func Warnf(f string, args ...interface{}) {
 // Panicf is like Panic but with a format-string
 func Panicf(f string, args ...interface{}) {
 	lvlf(LvlPanic, f, args...)
+	Flush()
 	panic(args)
 }
 
@@ -278,8 +255,8 @@ func Panicf(f string, args ...interface{}) {
 //
 // Usage: TestOutput( test.Verbose(), 2 )
 func TestOutput(show bool, level int) {
-	debugMut.Lock()
-	defer debugMut.Unlock()
+	varMut.Lock()
+	defer varMut.Unlock()
 
 	if show {
 		debugVisible = level
@@ -324,45 +301,45 @@ func LLvlf5(f string, args ...interface{}) { lvlf(-5, f, args...) }
 
 // SetDebugVisible set the global debug output level in a go-rountine-safe way
 func SetDebugVisible(lvl int) {
-	debugMut.Lock()
-	defer debugMut.Unlock()
+	varMut.Lock()
+	defer varMut.Unlock()
 	debugVisible = lvl
 }
 
 // DebugVisible returns the actual visible debug-level
 func DebugVisible() int {
-	debugMut.RLock()
-	defer debugMut.RUnlock()
+	varMut.RLock()
+	defer varMut.RUnlock()
 	return debugVisible
 }
 
 // SetShowTime allows for turning on the flag that adds the current
 // time to the debug-output
 func SetShowTime(show bool) {
-	debugMut.Lock()
-	defer debugMut.Unlock()
+	varMut.Lock()
+	defer varMut.Unlock()
 	showTime = show
 }
 
 // ShowTime returns the current setting for showing the time in the debug
 // output
 func ShowTime() bool {
-	debugMut.Lock()
-	defer debugMut.Unlock()
+	varMut.Lock()
+	defer varMut.Unlock()
 	return showTime
 }
 
 // SetUseColors can turn off or turn on the use of colors in the debug-output
 func SetUseColors(show bool) {
-	debugMut.Lock()
-	defer debugMut.Unlock()
+	varMut.Lock()
+	defer varMut.Unlock()
 	useColors = show
 }
 
 // UseColors returns the actual setting of the color-usage in dbg
 func UseColors() bool {
-	debugMut.Lock()
-	defer debugMut.Unlock()
+	varMut.Lock()
+	defer varMut.Unlock()
 	return useColors
 }
 
@@ -370,6 +347,7 @@ func UseColors() bool {
 func TestFatal(t *testing.T, err error, msg ...string) {
 	if err != nil {
 		lvld(LvlFatal, strings.Join(msg, " "), err)
+		Flush()
 		os.Exit(1)
 	}
 }
@@ -378,6 +356,12 @@ func TestFatal(t *testing.T, err error, msg ...string) {
 // - DEBUG_LVL - for the actual debug-lvl - default is 1
 // - DEBUG_TIME - whether to show the timestamp - default is false
 // - DEBUG_COLOR - whether to color the output - default is true
+// - DEBUG_SYSLOG - a syslog URL such as udp://host:514/tag to also send
+//   output to, if dbg/syslog has been imported
+// - DEBUG_FILE - a path to also write output to, if dbg/filesink has
+//   been imported
+// - DEBUG_FILE_ROTATE - a size such as 100MB at which DEBUG_FILE is
+//   rotated; ignored unless DEBUG_FILE is set
 func ParseEnv() {
 	var err error
 	dv := os.Getenv("DEBUG_LVL")
@@ -404,6 +388,27 @@ func ParseEnv() {
 			Error("Couldn't convert", dc, "to boolean")
 		}
 	}
+	ds := os.Getenv("DEBUG_SYSLOG")
+	if ds != "" {
+		if err := installSyslog(ds); err != nil {
+			Error("Couldn't set up syslog sink:", err)
+		}
+	}
+	df := os.Getenv("DEBUG_FILE")
+	if df != "" {
+		cfg := FileSinkConfig{Path: df}
+		if dr := os.Getenv("DEBUG_FILE_ROTATE"); dr != "" {
+			size, err := parseSize(dr)
+			if err != nil {
+				Error("Couldn't parse DEBUG_FILE_ROTATE:", err)
+			} else {
+				cfg.MaxSizeBytes = size
+			}
+		}
+		if err := installFileSink(cfg); err != nil {
+			Error("Couldn't set up file sink:", err)
+		}
+	}
 }
 
 // AddFlags adds the flags and the variables for the debug-control
@@ -412,4 +417,8 @@ func AddFlags() {
 	flag.IntVar(&debugVisible, "debug", DebugVisible(), "Change debug level (0-5)")
 	flag.BoolVar(&showTime, "debug-time", ShowTime(), "Shows the time of each message")
 	flag.BoolVar(&useColors, "debug-color", UseColors(), "Colors each message")
+	flag.Var(vmoduleFlag, "debug-vmodule", "Per-module debug level, e.g. 'sign/*=4,coconet/Put*=5,stampserver=2'")
+	flag.Var(fileRotateFlag, "debug-file-rotate", "Size at which -debug-file is rotated, e.g. '100MB' - pass before -debug-file")
+	flag.Var(fileSinkFlag, "debug-file", "Also write output to this file, rotating it per -debug-file-rotate")
+	flag.Var(syslogFlag, "debug-syslog", "Also send output to this syslog URL, e.g. 'udp://host:514/tag'")
 }
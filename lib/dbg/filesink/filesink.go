@@ -0,0 +1,166 @@
+// Package filesink provides a dbg.Handler that writes to a file, rotating
+// it once it grows past a configured size or age, optionally gzipping
+// rotated files and pruning old ones past a retention count.
+//
+// Importing this package registers it with dbg, so that
+// DEBUG_FILE=/var/log/conode.log (optionally with
+// DEBUG_FILE_ROTATE=100MB, or -debug-file/-debug-file-rotate on the
+// command line via dbg.AddFlags) is enough to start writing to it - no
+// further setup is needed:
+//
+//	import _ "github.com/dedis/cothority/lib/dbg/filesink"
+package filesink
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	dbg "github.com/dedis/cothority/lib/dbg"
+)
+
+func init() {
+	dbg.RegisterFileSinkFactory(New)
+}
+
+// handler writes Records to a file that it rotates according to cfg.
+type handler struct {
+	mu     sync.Mutex
+	cfg    dbg.FileSinkConfig
+	file   *os.File
+	size   int64
+	opened time.Time
+	inner  dbg.Handler // formats onto the current file via countingWriter
+}
+
+// New opens cfg.Path (creating it if necessary) and returns a Handler
+// that writes to it, rotating it per cfg.
+func New(cfg dbg.FileSinkConfig) (dbg.Handler, error) {
+	h := &handler{cfg: cfg}
+	if err := h.openCurrent(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *handler) openCurrent() error {
+	f, err := os.OpenFile(h.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	h.file = f
+	h.size = info.Size()
+	h.opened = time.Now()
+	h.inner = dbg.TextHandler(&countingWriter{w: f, h: h})
+	return nil
+}
+
+// countingWriter tracks how many bytes have been written to the current
+// file, so Handle can decide when to rotate without a Stat() per line.
+type countingWriter struct {
+	w io.Writer
+	h *handler
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.h.size += int64(n)
+	return n, err
+}
+
+func (h *handler) Enabled(int) bool { return true }
+
+func (h *handler) Handle(r dbg.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.needsRotate() {
+		if err := h.rotate(); err != nil {
+			return err
+		}
+	}
+	return h.inner.Handle(r)
+}
+
+func (h *handler) needsRotate() bool {
+	if h.cfg.MaxSizeBytes > 0 && h.size >= h.cfg.MaxSizeBytes {
+		return true
+	}
+	if h.cfg.MaxAge > 0 && time.Since(h.opened) >= h.cfg.MaxAge {
+		return true
+	}
+	return false
+}
+
+// rotate closes the current file, moves it aside (optionally gzipping
+// it), prunes old backups past cfg.MaxBackups, then opens a fresh file
+// at cfg.Path.
+func (h *handler) rotate() error {
+	if err := h.file.Close(); err != nil {
+		return err
+	}
+	backup := fmt.Sprintf("%s.%s", h.cfg.Path, time.Now().Format("20060102T150405.000000000"))
+	if err := os.Rename(h.cfg.Path, backup); err != nil {
+		return err
+	}
+	if h.cfg.Gzip {
+		if err := gzipAndRemove(backup); err != nil {
+			return err
+		}
+	}
+	h.pruneBackups()
+	return h.openCurrent()
+}
+
+func gzipAndRemove(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// pruneBackups deletes the oldest rotated files once there are more than
+// cfg.MaxBackups of them. Rotated file names are timestamp-suffixed, so
+// a lexicographic sort is also a chronological one.
+func (h *handler) pruneBackups() {
+	if h.cfg.MaxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(h.cfg.Path + ".*")
+	if err != nil {
+		return
+	}
+	sort.Strings(matches)
+	if len(matches) <= h.cfg.MaxBackups {
+		return
+	}
+	for _, old := range matches[:len(matches)-h.cfg.MaxBackups] {
+		os.Remove(old)
+	}
+}
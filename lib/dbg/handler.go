@@ -0,0 +1,376 @@
+package dbg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ct "github.com/daviddengcn/go-colortext"
+)
+
+// Record is the payload handed to a Handler for every Lvl*/Print/Error/...
+// call that passes the level check (the handler's Enabled check, or a
+// matching vmodule rule). It carries everything
+// needed to format or forward the entry without having to reach back into
+// the caller's stack.
+type Record struct {
+	// Time is when the call was made.
+	Time time.Time
+	// Lvl is the level the call was made at - see the Lvl* and LvlPrint..
+	// LvlPanic constants. Negative values (as produced by LLvl1..LLvl5)
+	// mean "always show".
+	Lvl int
+	// Caller is the short name (package.Function) of whoever called us.
+	Caller string
+	// Line is the line-number inside Caller, or 0 if Testing > 0.
+	Line int
+	// StaticMsg is a copy of the package-wide StaticMsg at call-time.
+	StaticMsg string
+	// Msg is the already-formatted message (arguments joined the same
+	// way fmt.Sprintln would).
+	Msg string
+	// Args are the raw arguments that were passed to the Lvl*-call, for
+	// handlers that want to do their own formatting.
+	Args []interface{}
+	// KV holds structured key/value fields attached to this call, as
+	// alternating key, value, key, value, ... - either inherited from a
+	// Logger's context (see With) or passed to one of the Lvl*Kv
+	// functions. It is nil for a plain Lvl*/Print/Error/... call.
+	KV []interface{}
+}
+
+// Handler processes Records produced by the Lvl*/Print/Error/...-family of
+// functions. Enabled is checked before a Record is even built, so a Handler
+// that discards most records can keep the hot path cheap; Handle is only
+// called for records it accepted - except at a call-site matched by a
+// vmodule rule (see SetVModule), where the rule's level alone decides and
+// Enabled is not consulted.
+type Handler interface {
+	// Enabled reports whether a call at the given level should be turned
+	// into a Record and passed to Handle at all.
+	Enabled(lvl int) bool
+	// Handle processes one Record, e.g. by formatting and writing it to
+	// a sink.
+	Handle(r Record) error
+}
+
+var (
+	rootHandler Handler = TerminalHandler()
+	handlerMut  sync.RWMutex
+)
+
+// SetHandler replaces the root Handler that every Lvl*/Print/Error/...-call
+// is dispatched to. The lock here only guards the swap itself - formatting
+// and writing a Record happens entirely outside of it, so concurrent
+// callers no longer serialize on a single global mutex the way they did
+// when output was written directly to stdout under debugMut.
+func SetHandler(h Handler) {
+	handlerMut.Lock()
+	defer handlerMut.Unlock()
+	rootHandler = h
+}
+
+// GetHandler returns the currently configured root Handler.
+func GetHandler() Handler {
+	handlerMut.RLock()
+	defer handlerMut.RUnlock()
+	return rootHandler
+}
+
+// lvlEnabled reports whether lvl should be visible given the global
+// debugVisible setting - the same comparison the old lvl() used to do
+// before formatting anything.
+func lvlEnabled(l int) bool {
+	return l <= DebugVisible()
+}
+
+// lvlLabel returns the one/two-character label used in front of every
+// line ("I", "W", "E", "F", "P" for the named levels, the numeric level
+// otherwise) together with the color and brightness to use for it.
+func lvlLabel(l int) (label string, col ct.Color, bright bool, hasColor bool) {
+	bright = l < 0
+	lvlAbs := l
+	if bright {
+		lvlAbs *= -1
+	}
+	switch l {
+	case LvlPrint:
+		return "I", ct.White, true, true
+	case LvlWarning:
+		return "W", ct.Green, true, true
+	case LvlError:
+		return "E", ct.Red, false, true
+	case LvlFatal:
+		return "F", ct.Red, true, true
+	case LvlPanic:
+		return "P", ct.Red, true, true
+	}
+	label = strconv.Itoa(lvlAbs)
+	if l < 0 {
+		label += "!"
+	}
+	if l != 0 && lvlAbs <= 5 {
+		colors := []ct.Color{ct.Yellow, ct.Cyan, ct.Green, ct.Blue, ct.Cyan}
+		return label, colors[lvlAbs-1], bright, true
+	}
+	return label, ct.Black, false, false
+}
+
+// formatLine renders a Record the way the original terminal output did:
+// "LL: (padded-caller: line@static) - message", optionally prefixed with
+// the time.
+func formatLine(r Record) string {
+	lineStr := fmt.Sprintf("%d", r.Line)
+	if len(r.Caller) > NamePadding && NamePadding > 0 {
+		NamePadding = len(r.Caller)
+	}
+	if len(lineStr) > LinePadding && LinePadding > 0 {
+		LinePadding = len(lineStr)
+	}
+	fmtstr := fmt.Sprintf("%%%ds: %%%dd", NamePadding, LinePadding)
+	caller := fmt.Sprintf(fmtstr, r.Caller, r.Line)
+	if r.StaticMsg != "" {
+		caller += "@" + r.StaticMsg
+	}
+	label, _, _, _ := lvlLabel(r.Lvl)
+	msg := r.Msg
+	if kv := formatKV(r.KV); kv != "" {
+		msg = strconvTrimNewline(msg) + " " + kv + "\n"
+	}
+	str := fmt.Sprintf(": (%s) - %s", caller, msg)
+	if showTime {
+		str = fmt.Sprintf("%s.%09d%s", r.Time.Format("06/02/01 15:04:05"), r.Time.Nanosecond(), str)
+	}
+	return fmt.Sprintf("%-2s%s", label, str)
+}
+
+// formatKV renders a Record's key/value pairs as "key1=val1 key2=val2",
+// the same way the terminal and text handlers append structured fields
+// after the free-form message. A trailing key without a value is shown as
+// "key=MISSING".
+func formatKV(kv []interface{}) string {
+	if len(kv) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, (len(kv)+1)/2)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			parts = append(parts, fmt.Sprintf("%v=%v", kv[i], kv[i+1]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%v=MISSING", kv[i]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// terminalHandler is the historical default: the colored "(caller: line) -
+// message" format, written straight to stdout via go-colortext.
+type terminalHandler struct{}
+
+// TerminalHandler returns the original colored stdout handler.
+func TerminalHandler() Handler {
+	return terminalHandler{}
+}
+
+func (terminalHandler) Enabled(l int) bool { return lvlEnabled(l) }
+
+func (terminalHandler) Handle(r Record) error {
+	line := formatLine(r)
+	TestStr = line
+	if Testing == 2 {
+		return nil
+	}
+	_, col, bright, hasColor := lvlLabel(r.Lvl)
+	if useColors && hasColor {
+		ct.Foreground(col, bright)
+	}
+	fmt.Print(line)
+	if useColors {
+		ct.ResetColor()
+	}
+	return nil
+}
+
+// textHandler writes the same "(caller: line) - message" format as the
+// terminal handler, but without any color escapes, to an arbitrary
+// io.Writer - useful for files or test buffers.
+type textHandler struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// TextHandler returns a Handler that writes the plain (uncolored) text
+// format to w.
+func TextHandler(w io.Writer) Handler {
+	return &textHandler{w: w}
+}
+
+func (t *textHandler) Enabled(l int) bool { return lvlEnabled(l) }
+
+func (t *textHandler) Handle(r Record) error {
+	line := formatLine(r)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := fmt.Fprint(t.w, line)
+	return err
+}
+
+// jsonHandler writes one JSON object per line to w. Besides the fixed
+// time/lvl/caller/line/msg fields, every key/value pair attached to the
+// Record (see Record.KV) is merged in as its own top-level field, so
+// e.g. dbg.With("round", 3).Lvl1("done") produces
+// {"caller":"...","line":...,"lvl":"1","msg":"done","round":3,"time":"..."}.
+type jsonHandler struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// JSONHandler returns a Handler that writes each Record as a single line
+// of JSON to w.
+func JSONHandler(w io.Writer) Handler {
+	return &jsonHandler{w: w}
+}
+
+func (j *jsonHandler) Enabled(l int) bool { return lvlEnabled(l) }
+
+func (j *jsonHandler) Handle(r Record) error {
+	label, _, _, _ := lvlLabel(r.Lvl)
+	obj := map[string]interface{}{
+		"time":   r.Time,
+		"lvl":    label,
+		"caller": r.Caller,
+		"line":   r.Line,
+		"msg":    strconvTrimNewline(r.Msg),
+	}
+	if r.StaticMsg != "" {
+		obj["staticMsg"] = r.StaticMsg
+	}
+	for i := 0; i < len(r.KV); i += 2 {
+		key, ok := r.KV[i].(string)
+		if !ok {
+			continue
+		}
+		if i+1 < len(r.KV) {
+			obj[key] = r.KV[i+1]
+		} else {
+			// A trailing, unpaired key - formatKV shows the same call as
+			// "key=MISSING" for the terminal/text handlers; match that here
+			// instead of silently dropping the field.
+			obj[key] = "MISSING"
+		}
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.w.Write(data); err != nil {
+		return err
+	}
+	_, err = j.w.Write([]byte("\n"))
+	return err
+}
+
+// strconvTrimNewline drops the trailing newline fmt.Sprintln leaves on
+// Record.Msg, which is redundant once the message is a JSON field.
+func strconvTrimNewline(s string) string {
+	if len(s) > 0 && s[len(s)-1] == '\n' {
+		return s[:len(s)-1]
+	}
+	return s
+}
+
+// writerHandler is the simplest possible sink: it writes nothing but the
+// formatted message itself, with no caller/level metadata, to w.
+type writerHandler struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// WriterHandler returns a Handler that writes just the message of every
+// Record to w.
+func WriterHandler(w io.Writer) Handler {
+	return &writerHandler{w: w}
+}
+
+func (wh *writerHandler) Enabled(l int) bool { return lvlEnabled(l) }
+
+func (wh *writerHandler) Handle(r Record) error {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	_, err := fmt.Fprint(wh.w, r.Msg)
+	return err
+}
+
+// multiHandler fans a Record out to every child Handler that is Enabled
+// for its level. The first error encountered is returned, but every
+// enabled handler is still given a chance to run.
+type multiHandler struct {
+	handlers []Handler
+}
+
+// MultiHandler returns a Handler that dispatches every Record to all of
+// hs.
+func MultiHandler(hs ...Handler) Handler {
+	return &multiHandler{handlers: hs}
+}
+
+func (m *multiHandler) Enabled(l int) bool {
+	for _, h := range m.handlers {
+		if h.Enabled(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *multiHandler) Handle(r Record) error {
+	var first error
+	for _, h := range m.handlers {
+		if !h.Enabled(r.Lvl) {
+			continue
+		}
+		if err := h.Handle(r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// filterHandler wraps another Handler and only lets Records through that
+// satisfy fn.
+type filterHandler struct {
+	fn func(r Record) bool
+	h  Handler
+}
+
+// NewFilterHandler returns a Handler that only forwards a Record to h when
+// fn(r) returns true - e.g. to show only a given level or only records
+// from a given caller.
+func NewFilterHandler(fn func(r Record) bool, h Handler) Handler {
+	return &filterHandler{fn: fn, h: h}
+}
+
+func (f *filterHandler) Enabled(l int) bool { return f.h.Enabled(l) }
+
+func (f *filterHandler) Handle(r Record) error {
+	if !f.fn(r) {
+		return nil
+	}
+	return f.h.Handle(r)
+}
+
+// discardHandler silently drops every Record. It is mostly useful in
+// tests that want to turn dbg-output off without touching debugVisible.
+type discardHandler struct{}
+
+// DiscardHandler returns a Handler that drops every Record it is given.
+func DiscardHandler() Handler { return discardHandler{} }
+
+func (discardHandler) Enabled(int) bool    { return false }
+func (discardHandler) Handle(Record) error { return nil }
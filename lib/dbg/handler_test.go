@@ -0,0 +1,111 @@
+package dbg
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestFormatKV(t *testing.T) {
+	cases := []struct {
+		name string
+		kv   []interface{}
+		want string
+	}{
+		{"nil", nil, ""},
+		{"empty", []interface{}{}, ""},
+		{"pairs", []interface{}{"a", 1, "b", "two"}, "a=1 b=two"},
+		{"trailing unpaired key", []interface{}{"a", 1, "b"}, "a=1 b=MISSING"},
+		{"single unpaired key", []interface{}{"a"}, "a=MISSING"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := formatKV(c.kv); got != c.want {
+				t.Errorf("formatKV(%v) = %q, want %q", c.kv, got, c.want)
+			}
+		})
+	}
+}
+
+func TestFormatLine(t *testing.T) {
+	origPad, origLinePad, origShowTime := NamePadding, LinePadding, showTime
+	defer func() {
+		NamePadding = origPad
+		LinePadding = origLinePad
+		showTime = origShowTime
+	}()
+	NamePadding = 8
+	LinePadding = 2
+	showTime = false
+
+	cases := []struct {
+		name string
+		r    Record
+		want string
+	}{
+		{
+			name: "plain message",
+			r:    Record{Lvl: 1, Caller: "pkg.Func", Line: 42, Msg: "hello\n"},
+			want: "1 : (pkg.Func: 42) - hello\n",
+		},
+		{
+			name: "with static message",
+			r:    Record{Lvl: 2, Caller: "pkg.Func", Line: 7, StaticMsg: "ctx", Msg: "hi\n"},
+			want: "2 : (pkg.Func:  7@ctx) - hi\n",
+		},
+		{
+			name: "with KV fields",
+			r:    Record{Lvl: LvlError, Caller: "pkg.Func", Line: 1, Msg: "boom\n", KV: []interface{}{"round", 3}},
+			want: "E : (pkg.Func:  1) - boom round=3\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := formatLine(c.r); got != c.want {
+				t.Errorf("formatLine(%+v) = %q, want %q", c.r, got, c.want)
+			}
+		})
+	}
+}
+
+func TestJSONHandlerKV(t *testing.T) {
+	cases := []struct {
+		name string
+		kv   []interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "paired fields",
+			kv:   []interface{}{"round", float64(3), "child", "node2"},
+			want: map[string]interface{}{"round": float64(3), "child": "node2"},
+		},
+		{
+			name: "trailing unpaired key",
+			kv:   []interface{}{"round", float64(3), "child"},
+			want: map[string]interface{}{"round": float64(3), "child": "MISSING"},
+		},
+		{
+			name: "non-string key is ignored",
+			kv:   []interface{}{1, "value"},
+			want: map[string]interface{}{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := JSONHandler(&buf)
+			if err := h.Handle(Record{Caller: "pkg.Func", Line: 1, Msg: "hi", KV: c.kv}); err != nil {
+				t.Fatalf("Handle: %v", err)
+			}
+			var obj map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &obj); err != nil {
+				t.Fatalf("json.Unmarshal(%s): %v", buf.Bytes(), err)
+			}
+			for k, want := range c.want {
+				if got := obj[k]; got != want {
+					t.Errorf("field %q = %v, want %v", k, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package dbg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSinkConfig configures a rotating file Handler (see dbg/filesink).
+// It lives here, rather than in the filesink subpackage, so that dbg
+// itself can build one from DEBUG_FILE/DEBUG_FILE_ROTATE without
+// importing filesink - which would otherwise create an import cycle,
+// since filesink imports dbg for the Handler/Record types.
+type FileSinkConfig struct {
+	// Path is the file the sink writes to; it is always the current,
+	// not-yet-rotated log file.
+	Path string
+	// MaxSizeBytes rotates the file once it grows past this size. 0
+	// disables size-based rotation.
+	MaxSizeBytes int64
+	// MaxAge rotates the file once it's older than this. 0 disables
+	// time-based rotation.
+	MaxAge time.Duration
+	// Gzip compresses a rotated file once it's been renamed aside.
+	Gzip bool
+	// MaxBackups is how many rotated files to keep around; older ones
+	// are deleted. 0 means keep them all.
+	MaxBackups int
+}
+
+// dbg/syslog and dbg/filesink each register a factory here in their
+// init(), so that ParseEnv/AddFlags can wire DEBUG_SYSLOG/DEBUG_FILE up
+// without dbg itself depending on either subpackage - only a program
+// that actually imports dbg/syslog or dbg/filesink pays for them, and
+// only then can their env vars/flags do anything.
+var (
+	syslogFactory   func(url string) (Handler, error)
+	filesinkFactory func(cfg FileSinkConfig) (Handler, error)
+)
+
+// RegisterSyslogFactory is called by dbg/syslog's init() to make
+// DEBUG_SYSLOG/-debug-syslog functional.
+func RegisterSyslogFactory(f func(url string) (Handler, error)) {
+	syslogFactory = f
+}
+
+// RegisterFileSinkFactory is called by dbg/filesink's init() to make
+// DEBUG_FILE/-debug-file functional.
+func RegisterFileSinkFactory(f func(cfg FileSinkConfig) (Handler, error)) {
+	filesinkFactory = f
+}
+
+// sinkMu guards baseHandler/fileSinkHandler/syslogHandler below, so that
+// ParseEnv (at process start) and a flag.Value's Set (during flag
+// parsing) can both install a sink without racing each other.
+var (
+	sinkMu          sync.Mutex
+	baseHandler     Handler // the Handler in place before any sink was installed
+	fileSinkHandler Handler
+	syslogHandler   Handler
+)
+
+// rebuildSinkChain recomputes the root Handler from baseHandler plus
+// whichever of fileSinkHandler/syslogHandler are currently installed.
+// Call with sinkMu held.
+func rebuildSinkChain() {
+	handlers := []Handler{baseHandler}
+	if fileSinkHandler != nil {
+		handlers = append(handlers, fileSinkHandler)
+	}
+	if syslogHandler != nil {
+		handlers = append(handlers, syslogHandler)
+	}
+	if len(handlers) == 1 {
+		SetHandler(baseHandler)
+		return
+	}
+	SetHandler(MultiHandler(handlers...))
+}
+
+func installSyslog(url string) error {
+	if syslogFactory == nil {
+		return fmt.Errorf("dbg: DEBUG_SYSLOG/-debug-syslog given but dbg/syslog isn't imported")
+	}
+	h, err := syslogFactory(url)
+	if err != nil {
+		return err
+	}
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	if baseHandler == nil {
+		baseHandler = GetHandler()
+	}
+	// Replace, rather than stack alongside, any syslog sink installed
+	// earlier - e.g. by DEBUG_SYSLOG in ParseEnv, before -debug-syslog is
+	// parsed - so the same target doesn't end up receiving every line
+	// twice.
+	syslogHandler = h
+	rebuildSinkChain()
+	return nil
+}
+
+func installFileSink(cfg FileSinkConfig) error {
+	if filesinkFactory == nil {
+		return fmt.Errorf("dbg: DEBUG_FILE/-debug-file given but dbg/filesink isn't imported")
+	}
+	h, err := filesinkFactory(cfg)
+	if err != nil {
+		return err
+	}
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+	if baseHandler == nil {
+		baseHandler = GetHandler()
+	}
+	// Same reasoning as installSyslog: replace rather than stack.
+	fileSinkHandler = h
+	rebuildSinkChain()
+	return nil
+}
+
+// fileRotateBytes holds the value of -debug-file-rotate, read by
+// fileSinkFlagValue.Set when -debug-file is itself parsed. Pass
+// -debug-file-rotate before -debug-file on the command line for it to
+// take effect, the same way flag.Value side effects always depend on
+// argument order.
+var fileRotateBytes int64
+
+type fileRotateFlagValue struct{}
+
+func (fileRotateFlagValue) String() string { return "" }
+
+func (fileRotateFlagValue) Set(v string) error {
+	size, err := parseSize(v)
+	if err != nil {
+		return err
+	}
+	fileRotateBytes = size
+	return nil
+}
+
+var fileRotateFlag fileRotateFlagValue
+
+type fileSinkFlagValue struct{}
+
+func (fileSinkFlagValue) String() string { return "" }
+
+func (fileSinkFlagValue) Set(path string) error {
+	return installFileSink(FileSinkConfig{Path: path, MaxSizeBytes: fileRotateBytes})
+}
+
+var fileSinkFlag fileSinkFlagValue
+
+type syslogFlagValue struct{}
+
+func (syslogFlagValue) String() string { return "" }
+
+func (syslogFlagValue) Set(url string) error {
+	return installSyslog(url)
+}
+
+var syslogFlag syslogFlagValue
+
+// parseSize parses a size such as "100MB", "512KB" or a bare byte count
+// like "2048" - the units DEBUG_FILE_ROTATE/-debug-file-rotate accept.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToUpper(s), u.suffix) {
+			numStr := s[:len(s)-len(u.suffix)]
+			n, err := strconv.ParseFloat(strings.TrimSpace(numStr), 64)
+			if err != nil {
+				return 0, fmt.Errorf("dbg: invalid size %q: %v", s, err)
+			}
+			return int64(n * float64(u.factor)), nil
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("dbg: invalid size %q: %v", s, err)
+	}
+	return n, nil
+}
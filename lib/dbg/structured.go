@@ -0,0 +1,133 @@
+package dbg
+
+import (
+	"fmt"
+	"os"
+)
+
+// Logger carries a set of key/value fields that are attached to every
+// subsequent call made through it, so callers that otherwise have to
+// interpolate the same context (round number, view, node name, ...) into
+// every format string can instead attach it once:
+//
+//	log := dbg.With("round", round.Name, "view", view)
+//	log.Lvl3("sent challenge")
+//	log.Lvl3("verified response")
+type Logger struct {
+	ctx []interface{}
+}
+
+// With returns a Logger that attaches kv (alternating key, value, key,
+// value, ...) to every call made through it.
+func With(kv ...interface{}) *Logger {
+	return &Logger{ctx: append([]interface{}(nil), kv...)}
+}
+
+// With returns a new Logger that inherits l's fields plus kv.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	ctx := make([]interface{}, 0, len(l.ctx)+len(kv))
+	ctx = append(ctx, l.ctx...)
+	ctx = append(ctx, kv...)
+	return &Logger{ctx: ctx}
+}
+
+// Needs two functions to keep the caller-depth the same as the
+// package-level Lvl1/lvld/lvl chain - see the comment there.
+func (l *Logger) lvld(lv int, args ...interface{}) {
+	lvl(lv, l.ctx, args...)
+}
+func (l *Logger) lvlf(lv int, f string, args ...interface{}) {
+	lvl(lv, l.ctx, fmt.Sprintf(f, args...))
+}
+
+// Lvl1 is like the package-level Lvl1, with l's context attached.
+func (l *Logger) Lvl1(args ...interface{}) { l.lvld(1, args...) }
+
+// Lvl2 is like the package-level Lvl2, with l's context attached.
+func (l *Logger) Lvl2(args ...interface{}) { l.lvld(2, args...) }
+
+// Lvl3 is like the package-level Lvl3, with l's context attached.
+func (l *Logger) Lvl3(args ...interface{}) { l.lvld(3, args...) }
+
+// Lvl4 is like the package-level Lvl4, with l's context attached.
+func (l *Logger) Lvl4(args ...interface{}) { l.lvld(4, args...) }
+
+// Lvl5 is like the package-level Lvl5, with l's context attached.
+func (l *Logger) Lvl5(args ...interface{}) { l.lvld(5, args...) }
+
+// Lvlf1 is like Lvl1 but with a format-string.
+func (l *Logger) Lvlf1(f string, args ...interface{}) { l.lvlf(1, f, args...) }
+
+// Lvlf2 is like Lvl2 but with a format-string.
+func (l *Logger) Lvlf2(f string, args ...interface{}) { l.lvlf(2, f, args...) }
+
+// Lvlf3 is like Lvl3 but with a format-string.
+func (l *Logger) Lvlf3(f string, args ...interface{}) { l.lvlf(3, f, args...) }
+
+// Lvlf4 is like Lvl4 but with a format-string.
+func (l *Logger) Lvlf4(f string, args ...interface{}) { l.lvlf(4, f, args...) }
+
+// Lvlf5 is like Lvl5 but with a format-string.
+func (l *Logger) Lvlf5(f string, args ...interface{}) { l.lvlf(5, f, args...) }
+
+// Error is like the package-level Error, with l's context attached.
+func (l *Logger) Error(args ...interface{}) { l.lvld(LvlError, args...) }
+
+// Errorf is like Error but with a format-string.
+func (l *Logger) Errorf(f string, args ...interface{}) { l.lvlf(LvlError, f, args...) }
+
+// Warn is like the package-level Warn, with l's context attached.
+func (l *Logger) Warn(args ...interface{}) { l.lvld(LvlWarning, args...) }
+
+// Warnf is like Warn but with a format-string.
+func (l *Logger) Warnf(f string, args ...interface{}) { l.lvlf(LvlWarning, f, args...) }
+
+// Fatal is like the package-level Fatal, with l's context attached.
+func (l *Logger) Fatal(args ...interface{}) {
+	l.lvld(LvlFatal, args...)
+	Flush()
+	os.Exit(1)
+}
+
+// Fatalf is like Fatal but with a format-string.
+func (l *Logger) Fatalf(f string, args ...interface{}) {
+	l.lvlf(LvlFatal, f, args...)
+	Flush()
+	os.Exit(1)
+}
+
+// lvldKv and lvlfKv keep the caller-depth the same as lvld/lvlf for the
+// *Kv family below: Lvl1Kv -> lvldKv -> lvl.
+func lvldKv(lv int, kv []interface{}, args ...interface{}) {
+	lvl(lv, kv, args...)
+}
+
+// Lvl1Kv is like Lvl1, followed by kv (alternating key, value, key,
+// value, ...) rendered as structured fields - "key=value" on the
+// terminal/text handlers, extra JSON fields on the JSON handler.
+func Lvl1Kv(msg string, kv ...interface{}) { lvldKv(1, kv, msg) }
+
+// Lvl2Kv is like Lvl1Kv but at level 2.
+func Lvl2Kv(msg string, kv ...interface{}) { lvldKv(2, kv, msg) }
+
+// Lvl3Kv is like Lvl1Kv but at level 3.
+func Lvl3Kv(msg string, kv ...interface{}) { lvldKv(3, kv, msg) }
+
+// Lvl4Kv is like Lvl1Kv but at level 4.
+func Lvl4Kv(msg string, kv ...interface{}) { lvldKv(4, kv, msg) }
+
+// Lvl5Kv is like Lvl1Kv but at level 5.
+func Lvl5Kv(msg string, kv ...interface{}) { lvldKv(5, kv, msg) }
+
+// ErrorKv is like Error but with structured fields, see Lvl1Kv.
+func ErrorKv(msg string, kv ...interface{}) { lvldKv(LvlError, kv, msg) }
+
+// WarnKv is like Warn but with structured fields, see Lvl1Kv.
+func WarnKv(msg string, kv ...interface{}) { lvldKv(LvlWarning, kv, msg) }
+
+// FatalKv is like Fatal but with structured fields, see Lvl1Kv.
+func FatalKv(msg string, kv ...interface{}) {
+	lvldKv(LvlFatal, kv, msg)
+	Flush()
+	os.Exit(1)
+}
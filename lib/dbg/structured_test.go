@@ -0,0 +1,46 @@
+package dbg
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestLoggerWithInheritsContext(t *testing.T) {
+	base := With("round", 3)
+	child := base.With("child", "node2")
+
+	if !reflect.DeepEqual(base.ctx, []interface{}{"round", 3}) {
+		t.Fatalf("base.ctx = %v, want [round 3]", base.ctx)
+	}
+	if !reflect.DeepEqual(child.ctx, []interface{}{"round", 3, "child", "node2"}) {
+		t.Fatalf("child.ctx = %v, want [round 3 child node2]", child.ctx)
+	}
+
+	// Extending child must not mutate base's own context.
+	child.With("view", 1)
+	if !reflect.DeepEqual(base.ctx, []interface{}{"round", 3}) {
+		t.Fatalf("base.ctx was mutated by child.With: %v", base.ctx)
+	}
+}
+
+func TestLoggerAttachesContextToRecord(t *testing.T) {
+	orig := GetHandler()
+	defer SetHandler(orig)
+
+	var mu sync.Mutex
+	var got []Record
+	SetHandler(recordingHandler{mu: &mu, records: &got})
+
+	With("round", 3).Lvl1("hello")
+	Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 1 {
+		t.Fatalf("got %d records, want 1", len(got))
+	}
+	if !reflect.DeepEqual(got[0].KV, []interface{}{"round", 3}) {
+		t.Fatalf("Record.KV = %v, want [round 3]", got[0].KV)
+	}
+}
@@ -0,0 +1,86 @@
+// Package syslog provides a dbg.Handler that forwards records to a local
+// or remote syslog daemon, mapping dbg's levels onto syslog severities:
+// LvlFatal/LvlPanic -> LOG_CRIT, LvlError -> LOG_ERR,
+// LvlWarning -> LOG_WARNING, LvlPrint/Lvl1 -> LOG_INFO, Lvl2 and
+// noisier -> LOG_DEBUG.
+//
+// Importing this package registers it with dbg, so that
+// DEBUG_SYSLOG=udp://host:514/tag (or -debug-syslog on the command line,
+// via dbg.AddFlags) is enough to start sending output to syslog - no
+// further setup is needed:
+//
+//	import _ "github.com/dedis/cothority/lib/dbg/syslog"
+package syslog
+
+import (
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"strings"
+
+	dbg "github.com/dedis/cothority/lib/dbg"
+)
+
+func init() {
+	dbg.RegisterSyslogFactory(New)
+}
+
+// handler writes Records to a syslog.Writer, picking the syslog severity
+// from the Record's level.
+type handler struct {
+	w *syslog.Writer
+}
+
+// New dials the syslog daemon described by rawURL, e.g.
+// "udp://host:514/tag" or "tcp://host:514/tag". A bare tag with no "://"
+// (just "tag") dials the local syslog daemon.
+func New(rawURL string) (dbg.Handler, error) {
+	network, raddr, tag, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &handler{w: w}, nil
+}
+
+// parseURL turns "udp://host:514/tag" into ("udp", "host:514", "tag").
+// A bare tag with no "://" dials the local syslog daemon.
+func parseURL(rawURL string) (network, raddr, tag string, err error) {
+	if !strings.Contains(rawURL, "://") {
+		return "", "", rawURL, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", "", fmt.Errorf("dbg/syslog: invalid URL %q: %v", rawURL, err)
+	}
+	return u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+func (h *handler) Enabled(int) bool { return true }
+
+func (h *handler) Handle(r dbg.Record) error {
+	msg := fmt.Sprintf("(%s) - %s", r.Caller, strings.TrimRight(r.Msg, "\n"))
+
+	switch r.Lvl {
+	case dbg.LvlFatal, dbg.LvlPanic:
+		return h.w.Crit(msg)
+	case dbg.LvlError:
+		return h.w.Err(msg)
+	case dbg.LvlWarning:
+		return h.w.Warning(msg)
+	case dbg.LvlPrint:
+		return h.w.Info(msg)
+	}
+
+	lvlAbs := r.Lvl
+	if lvlAbs < 0 {
+		lvlAbs = -lvlAbs
+	}
+	if lvlAbs <= 1 {
+		return h.w.Info(msg)
+	}
+	return h.w.Debug(msg)
+}
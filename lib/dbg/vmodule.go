@@ -0,0 +1,174 @@
+package dbg
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// vmoduleRule is one "pattern=level" entry of a parsed vmodule spec.
+type vmoduleRule struct {
+	raw         string
+	pattern     *regexp.Regexp
+	lvl         int
+	wholeModule bool // pattern had no '/', so it matches on the module name alone
+}
+
+var (
+	vmoduleMu    sync.RWMutex
+	vmoduleRules []vmoduleRule
+	// vmoduleCache remembers the outcome of matching a given call-site
+	// (identified by its PC) against the current rules, so that a call
+	// inside a hot loop only runs the glob matching once. It's held
+	// behind an atomic.Value, rather than being a plain sync.Map
+	// variable, because SetVModule replaces the whole map whenever the
+	// rules change (every cached decision is stale at that point) and
+	// that replacement has to be a single atomic pointer swap - Lvl*
+	// calls read vmoduleCache from arbitrary goroutines with no lock of
+	// their own.
+	vmoduleCache atomic.Value // *sync.Map, uintptr -> vmoduleCacheEntry
+)
+
+func init() {
+	vmoduleCache.Store(&sync.Map{})
+}
+
+type vmoduleCacheEntry struct {
+	lvl   int
+	found bool
+}
+
+// SetVModule installs a vmodule spec such as
+//
+//	sign/*=4,coconet/Put*=5,stampserver=2
+//
+// Each entry is "pattern=level" where pattern is a glob ('*' and '?' are
+// wildcards) matched against "module/Func" - e.g. "sign/*" matches every
+// call made from the sign module, "coconet/Put*" matches calls whose
+// function name starts with "Put" inside coconet. A pattern without a
+// '/' (like "stampserver") matches the whole module regardless of
+// function. A matching rule overrides debugVisible for that call-site;
+// an empty spec clears all rules.
+func SetVModule(spec string) error {
+	var rules []vmoduleRule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("dbg: invalid vmodule rule %q, want pattern=level", part)
+		}
+		pat := strings.TrimSpace(kv[0])
+		lvl, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return fmt.Errorf("dbg: invalid vmodule level in %q: %v", part, err)
+		}
+		re, whole, err := compileVModuleGlob(pat)
+		if err != nil {
+			return fmt.Errorf("dbg: invalid vmodule pattern %q: %v", pat, err)
+		}
+		rules = append(rules, vmoduleRule{raw: pat, pattern: re, lvl: lvl, wholeModule: whole})
+	}
+
+	vmoduleMu.Lock()
+	vmoduleRules = rules
+	vmoduleMu.Unlock()
+	// the rules changed, so every cached per-PC decision is stale; swap
+	// in a fresh map atomically rather than mutating the shared one in
+	// place, since vmoduleLevel may be reading it concurrently
+	vmoduleCache.Store(&sync.Map{})
+	return nil
+}
+
+// compileVModuleGlob turns a vmodule glob pattern into an anchored regexp.
+// whole reports whether pat had no '/' and should therefore be matched
+// against the module name alone rather than "module/Func".
+func compileVModuleGlob(pat string) (re *regexp.Regexp, whole bool, err error) {
+	whole = !strings.Contains(pat, "/")
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pat {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	re, err = regexp.Compile(b.String())
+	return re, whole, err
+}
+
+// vmoduleLevel returns the vmodule-overridden visibility level for the
+// call-site identified by pc/fullName, and whether any rule matched at
+// all - if none did, the caller should fall back to the global
+// debugVisible level.
+func vmoduleLevel(pc uintptr, fullName string) (lvl int, found bool) {
+	cache := vmoduleCache.Load().(*sync.Map)
+	if cached, ok := cache.Load(pc); ok {
+		entry := cached.(vmoduleCacheEntry)
+		return entry.lvl, entry.found
+	}
+
+	vmoduleMu.RLock()
+	rules := vmoduleRules
+	vmoduleMu.RUnlock()
+
+	module, matchName := vmoduleNames(fullName)
+	for _, r := range rules {
+		target := matchName
+		if r.wholeModule {
+			target = module
+		}
+		if r.pattern.MatchString(target) {
+			lvl, found = r.lvl, true
+		}
+	}
+	cache.Store(pc, vmoduleCacheEntry{lvl: lvl, found: found})
+	return lvl, found
+}
+
+// vmoduleNames splits a fully-qualified function name such as
+// "github.com/dedis/cothority/proto/sign.(*Round).VerifyResponses" into
+// its last path segment ("sign") and a "module/rest" form
+// ("sign/(*Round).VerifyResponses") suitable for vmodule glob matching.
+func vmoduleNames(fullName string) (module, matchName string) {
+	rest := fullName
+	if idx := strings.LastIndex(rest, "/"); idx >= 0 {
+		rest = rest[idx+1:]
+	}
+	dot := strings.Index(rest, ".")
+	if dot < 0 {
+		return rest, rest
+	}
+	module = rest[:dot]
+	return module, module + "/" + rest[dot+1:]
+}
+
+// vmoduleFlagValue wires SetVModule up as a flag.Value so that
+// "-debug-vmodule" takes effect as soon as flags are parsed.
+type vmoduleFlagValue struct{}
+
+func (vmoduleFlagValue) String() string {
+	vmoduleMu.RLock()
+	defer vmoduleMu.RUnlock()
+	parts := make([]string, len(vmoduleRules))
+	for i, r := range vmoduleRules {
+		parts[i] = fmt.Sprintf("%s=%d", r.raw, r.lvl)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (vmoduleFlagValue) Set(spec string) error {
+	return SetVModule(spec)
+}
+
+var vmoduleFlag vmoduleFlagValue
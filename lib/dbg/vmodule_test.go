@@ -0,0 +1,110 @@
+package dbg
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSetVModuleParsing(t *testing.T) {
+	defer SetVModule("")
+
+	if err := SetVModule("sign/*=4,coconet/Put*=5,stampserver=2"); err != nil {
+		t.Fatalf("SetVModule: %v", err)
+	}
+	if err := SetVModule("bad-rule"); err == nil {
+		t.Fatal("expected an error for a rule without '=level'")
+	}
+	if err := SetVModule("sign/*=notanumber"); err == nil {
+		t.Fatal("expected an error for a non-numeric level")
+	}
+}
+
+func TestVModuleLevelMatching(t *testing.T) {
+	defer SetVModule("")
+	if err := SetVModule("sign/*=4,coconet/Put*=5,stampserver=2"); err != nil {
+		t.Fatalf("SetVModule: %v", err)
+	}
+
+	cases := []struct {
+		fullName  string
+		wantLvl   int
+		wantFound bool
+	}{
+		{"github.com/dedis/cothority/proto/sign.(*Round).VerifyResponses", 4, true},
+		{"github.com/dedis/cothority/lib/stampserver.Run", 2, true},
+		{"github.com/dedis/cothority/lib/other.Foo", 0, false},
+	}
+	for i, c := range cases {
+		// A distinct fake PC per case avoids cross-case cache collisions.
+		lvl, found := vmoduleLevel(uintptr(0x1000+i), c.fullName)
+		if found != c.wantFound {
+			t.Errorf("%s: found = %v, want %v", c.fullName, found, c.wantFound)
+			continue
+		}
+		if found && lvl != c.wantLvl {
+			t.Errorf("%s: lvl = %d, want %d", c.fullName, lvl, c.wantLvl)
+		}
+	}
+}
+
+func TestVModuleLevelIsCached(t *testing.T) {
+	defer SetVModule("")
+	if err := SetVModule("dbg/*=5"); err != nil {
+		t.Fatalf("SetVModule: %v", err)
+	}
+
+	const pc = uintptr(0x2000)
+	full := "github.com/dedis/cothority/lib/dbg.someFunc"
+	lvl, found := vmoduleLevel(pc, full)
+	if !found || lvl != 5 {
+		t.Fatalf("first lookup: lvl=%d found=%v, want 5/true", lvl, found)
+	}
+
+	// Changing the rules without going through SetVModule must not affect
+	// an already-cached PC - this exercises the same cache the
+	// atomic.Value swap in SetVModule replaces wholesale.
+	vmoduleMu.Lock()
+	vmoduleRules = nil
+	vmoduleMu.Unlock()
+
+	lvl, found = vmoduleLevel(pc, full)
+	if !found || lvl != 5 {
+		t.Fatalf("cached lookup: lvl=%d found=%v, want 5/true (cache should still hold)", lvl, found)
+	}
+
+	if err := SetVModule(""); err != nil {
+		t.Fatalf("SetVModule: %v", err)
+	}
+	lvl, found = vmoduleLevel(pc, full)
+	if found {
+		t.Fatalf("after SetVModule cleared the cache: lvl=%d found=%v, want not found", lvl, found)
+	}
+}
+
+func TestVModuleRaisesAboveGlobalLevel(t *testing.T) {
+	origHandler := GetHandler()
+	origVisible := DebugVisible()
+	defer func() {
+		SetHandler(origHandler)
+		SetDebugVisible(origVisible)
+		SetVModule("")
+	}()
+
+	var mu sync.Mutex
+	var got []Record
+	SetHandler(recordingHandler{mu: &mu, records: &got})
+	SetDebugVisible(1)
+	if err := SetVModule("dbg/*=5"); err != nil {
+		t.Fatalf("SetVModule: %v", err)
+	}
+
+	Lvl4("should reach the handler despite the global level being 1")
+	Flush()
+
+	mu.Lock()
+	n := len(got)
+	mu.Unlock()
+	if n != 1 {
+		t.Fatalf("got %d records, want 1 - vmodule override should have raised visibility for this call-site", n)
+	}
+}
@@ -0,0 +1,126 @@
+package sign
+
+import (
+	"errors"
+	"fmt"
+
+	dbg "github.com/dedis/cothority/lib/dbg"
+)
+
+// Phase identifies which step of the collective-signing round an error
+// happened in.
+type Phase int
+
+const (
+	PhaseCommit Phase = iota
+	PhaseChallenge
+	PhaseResponse
+	PhaseVerify
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseCommit:
+		return "Commit"
+	case PhaseChallenge:
+		return "Challenge"
+	case PhaseResponse:
+		return "Response"
+	case PhaseVerify:
+		return "Verify"
+	default:
+		return "Unknown"
+	}
+}
+
+// Sentinel causes wrapped by RoundError, so callers can test for a
+// specific failure with errors.Is regardless of which round/view/child it
+// happened on.
+var (
+	// ErrElGamalVerify means the aggregate ElGamal collective signature
+	// did not reconstruct V_hat.
+	ErrElGamalVerify = errors.New("ElGamal collective signature verification failed")
+	// ErrChallengeRecompute means the root recomputed the challenge from
+	// the exception-adjusted aggregate and it didn't match the one it
+	// originally emitted.
+	ErrChallengeRecompute = errors.New("recomputed challenge does not match emitted challenge")
+	// ErrInvalidProof means the ChallengeMessage needed to build the local
+	// merkle proof was missing.
+	ErrInvalidProof = errors.New("invalid challenge message")
+)
+
+// RoundError carries the context needed to diagnose a failure in the
+// merkle-round pipeline - which round, which view, which phase, and
+// (when attributable) which child - instead of folding all of it into a
+// free-form string. It wraps the underlying cause, so errors.Unwrap/Is/As
+// still reach it: e.g. errors.Is(err, sign.ErrElGamalVerify).
+type RoundError struct {
+	RoundName string
+	View      int
+	Phase     Phase
+	Child     string // empty if the failure isn't attributable to one child
+	Err       error
+}
+
+func (e *RoundError) Error() string {
+	msg := fmt.Sprintf("round %s (view %d, phase %s)", e.RoundName, e.View, e.Phase)
+	if e.Child != "" {
+		msg += fmt.Sprintf(", child %s", e.Child)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap exposes the wrapped cause to errors.Is/errors.As.
+func (e *RoundError) Unwrap() error {
+	return e.Err
+}
+
+// KV renders e's fields as alternating key/value pairs, for attaching to
+// a structured log call, e.g. dbg.ErrorKv(e.Error(), e.KV()...).
+func (e *RoundError) KV() []interface{} {
+	kv := []interface{}{"round", e.RoundName, "view", e.View, "phase", e.Phase.String()}
+	if e.Child != "" {
+		kv = append(kv, "child", e.Child)
+	}
+	return kv
+}
+
+// logRoundError logs err's message and KV() fields through dbg, if err is
+// a *RoundError, before handing it back unchanged - meant to wrap a
+// constructor call at the point a RoundError is actually surfaced to its
+// caller, e.g. return logRoundError(errRespVerify(round, cause)). It's
+// deliberately not done inside the constructors themselves: a caller that
+// wants to retry or otherwise handle a failure quietly - a transient
+// child-send failure during a protocol retry, say - can still call
+// errChildSend without that forcing a log line, and a caller further up
+// that also logs the error it gets back won't see it logged twice.
+func logRoundError(err error) error {
+	if e, ok := err.(*RoundError); ok {
+		dbg.ErrorKv(e.Error(), e.KV()...)
+	}
+	return err
+}
+
+// errRespVerify wraps a failure of VerifyResponses' ElGamal check.
+func errRespVerify(round *Round, underlying error) error {
+	return &RoundError{RoundName: round.Name, View: round.View, Phase: PhaseVerify, Err: underlying}
+}
+
+// errInvalidProof wraps a failure to build or store the local merkle
+// proof during the challenge phase.
+func errInvalidProof(round *Round, underlying error) error {
+	return &RoundError{RoundName: round.Name, View: round.View, Phase: PhaseChallenge, Err: underlying}
+}
+
+// errChildSend wraps a failure to deliver a SigningMessage to child.
+func errChildSend(round *Round, child string, underlying error) error {
+	return &RoundError{RoundName: round.Name, View: round.View, Phase: PhaseChallenge, Child: child, Err: underlying}
+}
+
+// errMarshalLog wraps a failure to marshal the round's log for hashing.
+func errMarshalLog(round *Round, underlying error) error {
+	return &RoundError{RoundName: round.Name, View: round.View, Phase: PhaseCommit, Err: underlying}
+}
@@ -4,9 +4,8 @@ import (
 	"sort"
 	"github.com/dedis/cothority/lib/proof"
 	"bytes"
-	dbg "github.com/dedis/cothority/lib/debug_lvl"
+	dbg "github.com/dedis/cothority/lib/dbg"
 	"github.com/dedis/crypto/abstract"
-	"errors"
 "github.com/dedis/cothority/lib/coconet"
 )
 
@@ -62,7 +61,7 @@ func (round *Round) MerkleHashLog() error {
 	h := round.Suite.Hash()
 	logBytes, err := round.Log.MarshalBinary()
 	if err != nil {
-		return err
+		return logRoundError(errMarshalLog(round, err))
 	}
 	h.Write(logBytes)
 	round.HashedLog = h.Sum(nil)
@@ -130,6 +129,9 @@ func (round *Round) InitResponseCrypto() {
 // store it in Node so that we can send it to the clients during
 // the SignatureBroadcast
 func (round *Round) StoreLocalMerkleProof(chm *ChallengeMessage) error {
+	if chm == nil {
+		return logRoundError(errInvalidProof(round, ErrInvalidProof))
+	}
 	proofForClient := make(proof.Proof, len(chm.Proof))
 	copy(proofForClient, chm.Proof)
 
@@ -138,7 +140,7 @@ func (round *Round) StoreLocalMerkleProof(chm *ChallengeMessage) error {
 	proofForClient = append(proofForClient, round.Proofs["local"]...)
 
 	// if want to verify partial and full proofs
-	if dbg.DebugVisible > 2 {
+	if dbg.DebugVisible() > 2 {
 		//sn.VerifyAllProofs(view, chm, proofForClient)
 	}
 	round.Proof = proofForClient
@@ -200,9 +202,10 @@ func (round *Round) VerifyResponses() error {
 
 	// intermediary nodes check partial responses aginst their partial keys
 	// the root node is also able to check against the challenge it emitted
-	if !T.Equal(round.Log.V_hat) || (isroot && !round.C.Equal(c2)) {
-		return errors.New("Verifying ElGamal Collective Signature failed in " +
-		round.Name)
+	if !T.Equal(round.Log.V_hat) {
+		return logRoundError(errRespVerify(round, ErrElGamalVerify))
+	} else if isroot && !round.C.Equal(c2) {
+		return logRoundError(errRespVerify(round, ErrChallengeRecompute))
 	} else if isroot {
 		dbg.Lvl4(round.Name, "reports ElGamal Collective Signature succeeded")
 	}
@@ -228,7 +231,7 @@ func (round *Round) SendChildrenChallengesProofs(chm *ChallengeMessage) error {
 		// send challenge message to child
 		// dbg.Lvl4("connection: sending children challenge proofs:", name, conn)
 		if err := conn.PutData(messg); err != nil {
-			return err
+			return logRoundError(errChildSend(round, name, err))
 		}
 	}
 